@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+const (
+	// rsyncCommand is the command to use to invoke rsync.
+	rsyncCommand = "rsync"
+
+	// rsyncArchiveFlags are the behavioral flags to pass to rsync for archiving
+	// behavior. The "-a" flag is the standard archiving configuration (see
+	// "man rsync" for more details), and the "-h" flag shows numbers in
+	// human-readable format.
+	rsyncArchiveFlags = "-ah"
+
+	// rsyncProgressFlag displays human-readable progress output. It's
+	// omitted in "-json" mode in favor of rsyncJSONInfoFlag/
+	// rsyncJSONOutFormatFlag.
+	rsyncProgressFlag = "-P"
+
+	// rsyncDisableSpecials is the flag to disable copying special files (e.g.
+	// sockets and FIFOs).
+	rsyncDisableSpecials = "--no-specials"
+
+	// rsyncDisableDevices is the flag to disable copying device files.
+	rsyncDisableDevices = "--no-devices"
+
+	// rsyncBaseFlagFormat is a format string for the flag to use to tell rsync
+	// to use a path as a base for snapshots.
+	rsyncBaseFlagFormat = "--link-dest=%s"
+
+	// rsyncExcludeFlagFormat is a format string for the flag to use to tell
+	// rsync to exclude a path.
+	rsyncExcludeFlagFormat = "--exclude=%s"
+)
+
+var backupUsage = `usage: snapper backup [-h|--help] [-exclude=<excluded-path>] [-exclude-file=<path>]
+                       [-exclude-caches] [-exclude-caches-keep-tag]
+                       [-host=<host>] [-tag=<tag>] [-retry-lock=<duration>] [-json]
+                       [-parent=<snapshot-name|auto|none>] [-parent-host=<host>] [-parent-tag=<tag>]
+                       [-link-dest-parent=<snapshot-name>] <root> <snapshots>
+`
+
+type excludes []string
+
+func (e *excludes) String() string {
+	return "excluded paths"
+}
+
+func (e *excludes) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
+
+type tags []string
+
+func (t *tags) String() string {
+	return "tags"
+}
+
+func (t *tags) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+type linkDestParents []string
+
+func (l *linkDestParents) String() string {
+	return "link-dest parents"
+}
+
+func (l *linkDestParents) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// backupMain implements the "snapper backup" subcommand.
+func backupMain(arguments []string) error {
+	// Parse command line arguments.
+	var excludes excludes
+	var excludeFiles excludeFiles
+	var tags tags
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	flags.Usage = func() {}
+	flags.SetOutput(ioutil.Discard)
+	flags.Var(&excludes, "exclude", "adds a path (relative to root) to be excluded")
+	flags.Var(&excludeFiles, "exclude-file", "adds patterns from a restic-style exclude file (repeatable)")
+	excludeCaches := flags.Bool("exclude-caches", false, "exclude directories tagged per the Cache Directory Tagging Standard")
+	excludeCachesKeepTag := flags.Bool("exclude-caches-keep-tag", false, "still copy the CACHEDIR.TAG file itself when excluding a tagged cache directory")
+	host := flags.String("host", "", "overrides the hostname recorded in the snapshot's metadata")
+	flags.Var(&tags, "tag", "adds a tag to be recorded in the snapshot's metadata (repeatable)")
+	retryLock := flags.Duration("retry-lock", 0, "retry for this duration if the snapshots directory is locked by another process")
+	jsonOutput := flags.Bool("json", false, "emit newline-delimited JSON progress and summary records instead of rsync's human-readable output")
+	parent := flags.String("parent", parentAuto, "parent snapshot to hardlink against: a snapshot name, \"auto\", or \"none\"")
+	parentHost := flags.String("parent-host", "", "restrict \"-parent=auto\" resolution to snapshots from this host")
+	parentTag := flags.String("parent-tag", "", "restrict \"-parent=auto\" resolution to snapshots carrying this tag")
+	var linkDestParents linkDestParents
+	flags.Var(&linkDestParents, "link-dest-parent", "adds an additional snapshot to hardlink against (repeatable)")
+	if err := flags.Parse(arguments); err == flag.ErrHelp {
+		fmt.Print(backupUsage)
+		os.Exit(0)
+	} else if err != nil {
+		return fmt.Errorf("%w\n%s", err, backupUsage)
+	}
+	positional := flags.Args()
+	if len(positional) != 2 {
+		return fmt.Errorf("invalid number of positional arguments\n%s", backupUsage)
+	}
+	root := positional[0]
+	if root == "" {
+		return fmt.Errorf("empty root path")
+	}
+	snapshotsDirectory := positional[1]
+	if snapshotsDirectory == "" {
+		return fmt.Errorf("empty snapshots directory path")
+	}
+
+	// Resolve the hostname to record in the snapshot's metadata.
+	hostname := *host
+	if hostname == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("unable to determine hostname: %w", err)
+		}
+		hostname = h
+	}
+
+	// Ensure that the snapshots root exists.
+	if err := os.MkdirAll(snapshotsDirectory, snapshotPermissions); err != nil {
+		return fmt.Errorf("unable to create snapshots directory: %w", err)
+	}
+
+	// Take an exclusive lock on the snapshots directory so that concurrent
+	// invocations of "snapper backup" can't race on creating the timestamped
+	// snapshot directory or clobber the Latest symlink.
+	lock, err := acquireLock(filepath.Join(snapshotsDirectory, lockFileName), *retryLock)
+	if err != nil {
+		return fmt.Errorf("unable to lock snapshots directory: %w", err)
+	}
+	defer lock.Release()
+
+	// Create base rsync arguments.
+	rsyncArguments := []string{rsyncArchiveFlags, rsyncDisableSpecials, rsyncDisableDevices}
+	if *jsonOutput {
+		rsyncArguments = append(rsyncArguments, rsyncJSONInfoFlag, rsyncJSONOutFormatFlag)
+	} else {
+		rsyncArguments = append(rsyncArguments, rsyncProgressFlag)
+	}
+
+	// Resolve the parent snapshot(s) to hardlink against, if any, and tell
+	// rsync to use them as hardlink bases.
+	lastestSnapshotLink := filepath.Join(snapshotsDirectory, latestSnapshotLinkName)
+	parentOpts := parentOptions{parent: *parent, host: *parentHost, tag: *parentTag, extra: linkDestParents}
+	parents, err := resolveParents(snapshotsDirectory, parentOpts, hostname, tags)
+	if err != nil {
+		return fmt.Errorf("unable to resolve parent snapshots: %w", err)
+	}
+	for _, p := range parents {
+		rsyncArguments = append(rsyncArguments, fmt.Sprintf(rsyncBaseFlagFormat, p))
+	}
+	hasParent := len(parents) > 0
+
+	// Load patterns from any exclude files.
+	var excludeFilePatterns []excludePattern
+	for _, p := range excludeFiles {
+		patterns, err := parseExcludeFile(p)
+		if err != nil {
+			return fmt.Errorf("unable to load exclude file: %w", err)
+		}
+		excludeFilePatterns = append(excludeFilePatterns, patterns...)
+	}
+
+	// Translate excluded paths and exclude file patterns into rsync
+	// arguments, merging the latter in via a temporary filter file so that
+	// restic-style "!" re-include patterns work correctly.
+	excludeArgumentsStart := len(rsyncArguments)
+	excludeArguments, excludeCleanup, err := rsyncExcludeArguments(excludes, excludeFilePatterns)
+	if err != nil {
+		return fmt.Errorf("unable to translate excludes: %w", err)
+	}
+	defer excludeCleanup()
+	rsyncArguments = append(rsyncArguments, excludeArguments...)
+
+	// If requested, walk root looking for tagged cache directories and
+	// exclude them.
+	if *excludeCaches {
+		caches, err := findCacheDirectories(root)
+		if err != nil {
+			return fmt.Errorf("unable to scan for cache directories: %w", err)
+		}
+		rsyncArguments = append(rsyncArguments, cachedirExcludeArguments(caches, *excludeCachesKeepTag)...)
+	}
+
+	// Record the fully resolved set of exclude arguments for the snapshot's
+	// metadata, before appending the root and destination paths.
+	resolvedExcludes := append([]string{}, rsyncArguments[excludeArgumentsStart:]...)
+
+	// Add the root path, but ensure that it has a trailing slash, because we
+	// want its contents to go directly into the snapshot root. rsync is
+	// sensitive to whether or not the source ends with a trailing slash. It
+	// doesn't care whether or not the destination has a trailing slash:
+	//	http://defindit.com/readme_files/rsync_backup.html
+	if root[len(root)-1] != '/' {
+		root += "/"
+	}
+	rsyncArguments = append(rsyncArguments, root)
+
+	// Compute the date, convert it to a UTC ISO-8601 timestamp (Go uses this
+	// weird WYSIWYG timestamp formatting string), and use that as the snapshot
+	// name. Attempt to create the directory, aborting if that's not possible.
+	// If all succeeds, then add the destination argument.
+	timestamp := time.Now().UTC()
+	name := timestamp.Format(snapshots.TimestampFormat)
+	snapshot := filepath.Join(snapshotsDirectory, name)
+	if err := os.Mkdir(snapshot, snapshotPermissions); err != nil {
+		return fmt.Errorf("unable to create snapshot root: %w", err)
+	}
+	rsyncArguments = append(rsyncArguments, snapshot)
+
+	// Run rsync, canceling it if we receive SIGINT or SIGTERM so that the
+	// lock (released via the deferred call above) isn't held by a process
+	// stuck waiting on a child that will never exit.
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if _, ok := <-signals; ok {
+			cancel()
+		}
+	}()
+	defer close(signals)
+	defer signal.Stop(signals)
+
+	var rsyncExitCode int
+	if *jsonOutput {
+		rsyncExitCode, _, err = runRsyncJSON(ctx, rsyncArguments, os.Stdout, name, hasParent)
+		if err != nil {
+			return err
+		}
+	} else {
+		rsync := exec.CommandContext(ctx, rsyncCommand, rsyncArguments...)
+		rsync.Stdin = os.Stdin
+		rsync.Stdout = os.Stdout
+		rsync.Stderr = os.Stderr
+		if runErr := rsync.Run(); runErr != nil {
+			if exitErr, ok := runErr.(*exec.ExitError); ok {
+				rsyncExitCode = exitErr.ExitCode()
+			} else {
+				return fmt.Errorf("rsync execution error: %w", runErr)
+			}
+		}
+	}
+
+	// Write the snapshot's metadata.
+	metadata := &snapshots.Metadata{
+		Timestamp:     timestamp,
+		Host:          hostname,
+		Root:          root,
+		Excludes:      resolvedExcludes,
+		Tags:          tags,
+		RsyncExitCode: rsyncExitCode,
+	}
+	if err := metadata.Save(snapshot); err != nil {
+		return fmt.Errorf("unable to write snapshot metadata: %w", err)
+	}
+
+	if rsyncExitCode != 0 {
+		return fmt.Errorf("rsync exited with code %d", rsyncExitCode)
+	}
+
+	// Update the last backup link.
+	if err := os.Remove(lastestSnapshotLink); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove latest backup link: %w", err)
+	} else if err = os.Symlink(name, lastestSnapshotLink); err != nil {
+		return fmt.Errorf("unable to update latest backup link: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// cachedirTagFileName is the name of the file, per the Cache Directory
+	// Tagging Standard, that marks a directory as being a cache (and thus
+	// safely excludable from backups). See
+	// https://bford.info/cachedir/spec.html for the full specification.
+	cachedirTagFileName = "CACHEDIR.TAG"
+
+	// cachedirTagSignature is the required first 43 bytes of a valid
+	// CACHEDIR.TAG file.
+	cachedirTagSignature = "Signature: 8a477f597d28d172789f06886806bc55"
+
+	// cachedirExcludeFlagFormat is a format string for the flag to use to
+	// tell rsync to exclude a rooted cache directory. The trailing slash
+	// ensures rsync treats it as a directory match rather than a file match.
+	cachedirExcludeFlagFormat = "--exclude=/%s/"
+
+	// cachedirIncludeDirFlagFormat is a format string for the flag that lets
+	// rsync descend into a rooted cache directory despite the exclude rules
+	// below it. rsync prunes excluded directories before descending, so this
+	// include rule must come first for cachedirTagIncludeFlagFormat (for a
+	// file inside the directory) to ever be evaluated.
+	cachedirIncludeDirFlagFormat = "--include=/%s/"
+
+	// cachedirTagIncludeFlagFormat is a format string for the flag to use
+	// to tell rsync to still copy the tag file itself out of an otherwise
+	// excluded cache directory, for round-tripping purposes.
+	cachedirTagIncludeFlagFormat = "--include=/%s/" + cachedirTagFileName
+
+	// cachedirExcludeContentsFlagFormat is a format string for the flag used
+	// to exclude everything inside a rooted cache directory other than the
+	// tag file, once descent into the directory itself has been permitted.
+	cachedirExcludeContentsFlagFormat = "--exclude=/%s/*"
+)
+
+// hasCachedirTag returns whether or not the given directory contains a valid
+// CACHEDIR.TAG file, per the Cache Directory Tagging Standard.
+func hasCachedirTag(directory string) (bool, error) {
+	file, err := os.Open(filepath.Join(directory, cachedirTagFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	signature := make([]byte, len(cachedirTagSignature))
+	if _, err := io.ReadFull(file, signature); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return string(signature) == cachedirTagSignature, nil
+}
+
+// findCacheDirectories walks root looking for directories tagged per the
+// Cache Directory Tagging Standard, returning their paths relative to root.
+// It does not descend into directories once they've been identified as
+// caches, since everything beneath them will be excluded anyway.
+func findCacheDirectories(root string) ([]string, error) {
+	var caches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root || !info.IsDir() {
+			return nil
+		}
+		tagged, err := hasCachedirTag(path)
+		if err != nil {
+			return fmt.Errorf("unable to check cache tag for %s: %w", path, err)
+		}
+		if !tagged {
+			return nil
+		}
+		relative, err := filepath.Rel(root, path)
+		if err != nil {
+			return fmt.Errorf("unable to compute relative path for %s: %w", path, err)
+		}
+		caches = append(caches, relative)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return caches, nil
+}
+
+// cachedirExcludeArguments translates a set of cache directories (relative to
+// root, as returned by findCacheDirectories) into rsync arguments. If
+// keepTag is true, the tag file itself is still included so that the cache
+// directory round-trips with its CACHEDIR.TAG intact; since rsync prunes
+// excluded directories before descending into them, this requires first
+// including the directory itself (to permit descent), then the tag file,
+// and only then excluding the rest of the directory's contents — a plain
+// "--exclude=/dir/" followed by "--include=/dir/TAG" would never reach the
+// include rule, since the directory would already have been pruned.
+func cachedirExcludeArguments(caches []string, keepTag bool) []string {
+	var arguments []string
+	for _, c := range caches {
+		if keepTag {
+			arguments = append(arguments,
+				fmt.Sprintf(cachedirIncludeDirFlagFormat, c),
+				fmt.Sprintf(cachedirTagIncludeFlagFormat, c),
+				fmt.Sprintf(cachedirExcludeContentsFlagFormat, c),
+			)
+		} else {
+			arguments = append(arguments, fmt.Sprintf(cachedirExcludeFlagFormat, c))
+		}
+	}
+	return arguments
+}
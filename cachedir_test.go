@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestHasCachedirTag(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-cachedir-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	valid := filepath.Join(directory, "valid")
+	invalid := filepath.Join(directory, "invalid")
+	missing := filepath.Join(directory, "missing")
+	for _, d := range []string{valid, invalid, missing} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatalf("unable to create directory %s: %v", d, err)
+		}
+	}
+
+	validTag := cachedirTagSignature + "\n# Some extra trailer content.\n"
+	if err := ioutil.WriteFile(filepath.Join(valid, cachedirTagFileName), []byte(validTag), 0600); err != nil {
+		t.Fatalf("unable to write valid tag: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(invalid, cachedirTagFileName), []byte("not a real tag"), 0600); err != nil {
+		t.Fatalf("unable to write invalid tag: %v", err)
+	}
+
+	if ok, err := hasCachedirTag(valid); err != nil || !ok {
+		t.Errorf("expected valid tag to be detected, got ok=%v, err=%v", ok, err)
+	}
+	if ok, err := hasCachedirTag(invalid); err != nil || ok {
+		t.Errorf("expected invalid tag to be rejected, got ok=%v, err=%v", ok, err)
+	}
+	if ok, err := hasCachedirTag(missing); err != nil || ok {
+		t.Errorf("expected missing tag to be rejected, got ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestFindCacheDirectories(t *testing.T) {
+	root, err := ioutil.TempDir("", "snapper-cachedir-walk-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	cache := filepath.Join(root, "sub", "cache")
+	other := filepath.Join(root, "sub", "other")
+	for _, d := range []string{cache, other} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatalf("unable to create directory %s: %v", d, err)
+		}
+	}
+	tagContents := cachedirTagSignature + "\n"
+	if err := ioutil.WriteFile(filepath.Join(cache, cachedirTagFileName), []byte(tagContents), 0600); err != nil {
+		t.Fatalf("unable to write tag: %v", err)
+	}
+	// Nested directory beneath a tagged cache should not be reported
+	// separately, since the walk should not descend into it. It carries its
+	// own valid tag, so it would be reported if the walk did descend.
+	nested := filepath.Join(cache, "nested")
+	if err := os.MkdirAll(nested, 0700); err != nil {
+		t.Fatalf("unable to create nested directory: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(nested, cachedirTagFileName), []byte(tagContents), 0600); err != nil {
+		t.Fatalf("unable to write nested tag: %v", err)
+	}
+
+	caches, err := findCacheDirectories(root)
+	if err != nil {
+		t.Fatalf("findCacheDirectories failed: %v", err)
+	}
+	sort.Strings(caches)
+	expected := []string{filepath.Join("sub", "cache")}
+	if len(caches) != len(expected) {
+		t.Fatalf("got %v, expected %v", caches, expected)
+	}
+	for i, c := range caches {
+		if c != expected[i] {
+			t.Errorf("cache %d: got %q, expected %q", i, c, expected[i])
+		}
+	}
+}
+
+func TestCachedirExcludeArgumentsWithoutKeepTag(t *testing.T) {
+	arguments := cachedirExcludeArguments([]string{"sub/cache"}, false)
+	expected := []string{"--exclude=/sub/cache/"}
+	if len(arguments) != len(expected) {
+		t.Fatalf("got %v, expected %v", arguments, expected)
+	}
+	for i, a := range arguments {
+		if a != expected[i] {
+			t.Errorf("argument %d: got %q, expected %q", i, a, expected[i])
+		}
+	}
+}
+
+func TestCachedirExcludeArgumentsWithKeepTag(t *testing.T) {
+	arguments := cachedirExcludeArguments([]string{"sub/cache"}, true)
+
+	// rsync evaluates include/exclude rules in order and prunes a directory
+	// as soon as it matches an exclude rule, so the directory itself must be
+	// included (to permit descent) before the tag file's include rule, which
+	// in turn must precede the exclude rule for the directory's remaining
+	// contents — otherwise the tag file is pruned along with everything
+	// else.
+	expected := []string{
+		"--include=/sub/cache/",
+		"--include=/sub/cache/CACHEDIR.TAG",
+		"--exclude=/sub/cache/*",
+	}
+	if len(arguments) != len(expected) {
+		t.Fatalf("got %v, expected %v", arguments, expected)
+	}
+	for i, a := range arguments {
+		if a != expected[i] {
+			t.Errorf("argument %d: got %q, expected %q", i, a, expected[i])
+		}
+	}
+}
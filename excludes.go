@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// rsyncFilterMergeFlagFormat is a format string for the flag to use to
+	// tell rsync to merge a filter file into its rule set. Merged filter
+	// files support the "+"/"-" include/exclude prefixes that
+	// "--exclude"/"--include" can't express on their own (e.g. re-including
+	// a path underneath an excluded one).
+	rsyncFilterMergeFlagFormat = "--filter=merge %s"
+
+	// excludeUnignorePrefix is the prefix used in exclude files (following
+	// restic's convention) to re-include a path that would otherwise be
+	// excluded by an earlier pattern.
+	excludeUnignorePrefix = "!"
+
+	// excludeCommentPrefix is the prefix used in exclude files to denote a
+	// comment line.
+	excludeCommentPrefix = "#"
+)
+
+// excludeFiles is a flag.Value implementation that accumulates the paths
+// passed via repeated "-exclude-file" flags.
+type excludeFiles []string
+
+func (e *excludeFiles) String() string {
+	return "exclude files"
+}
+
+func (e *excludeFiles) Set(value string) error {
+	*e = append(*e, value)
+	return nil
+}
+
+// excludePattern represents a single pattern parsed from an exclude file,
+// already stripped of its restic-style "!" unignore prefix.
+type excludePattern struct {
+	// pattern is the raw (environment-expanded) pattern text.
+	pattern string
+	// unignore indicates that this pattern re-includes paths that would
+	// otherwise be excluded, rather than excluding them.
+	unignore bool
+}
+
+// parseExcludeFile reads a restic-style exclude file, ignoring blank lines
+// and "#" comments, expanding environment variables in each pattern, and
+// recognizing the "!pattern" unignore form.
+func parseExcludeFile(path string) ([]excludePattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open exclude file: %w", err)
+	}
+	defer file.Close()
+
+	var patterns []excludePattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, excludeCommentPrefix) {
+			continue
+		}
+		unignore := strings.HasPrefix(line, excludeUnignorePrefix)
+		if unignore {
+			line = strings.TrimSpace(strings.TrimPrefix(line, excludeUnignorePrefix))
+		}
+		line = os.ExpandEnv(line)
+		if line == "" {
+			continue
+		}
+		patterns = append(patterns, excludePattern{pattern: line, unignore: unignore})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read exclude file: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// rsyncExcludeArguments translates a set of simple "-exclude" paths and a set
+// of patterns loaded from "-exclude-file" files into rsync arguments. Simple
+// excludes are passed through as "--exclude" flags, but any pattern loaded
+// from a file is written into a temporary rsync filter file (since
+// "--exclude" can't express restic's "!" re-include semantics) and merged in
+// via "--filter=merge". It returns the resulting rsync arguments along with a
+// cleanup function that removes the temporary filter file (a no-op if none
+// was created); the caller should always invoke the cleanup function, even on
+// error paths, once it's done invoking rsync.
+func rsyncExcludeArguments(excludes []string, filePatterns []excludePattern) ([]string, func(), error) {
+	cleanup := func() {}
+
+	var arguments []string
+	for _, p := range excludes {
+		arguments = append(arguments, fmt.Sprintf(rsyncExcludeFlagFormat, p))
+	}
+
+	if len(filePatterns) == 0 {
+		return arguments, cleanup, nil
+	}
+
+	filter, err := ioutil.TempFile("", "snapper-filter")
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("unable to create temporary filter file: %w", err)
+	}
+	cleanup = func() {
+		os.Remove(filter.Name())
+	}
+
+	// rsync filter rules are first-match-wins, so unignore ("+") patterns
+	// must be written before the broader exclude ("-") patterns they're
+	// meant to re-include underneath, or the exclude rule would shadow them
+	// first. Preserve relative order within each group.
+	writer := bufio.NewWriter(filter)
+	for _, p := range filePatterns {
+		if p.unignore {
+			if _, err := fmt.Fprintf(writer, "+ %s\n", p.pattern); err != nil {
+				filter.Close()
+				return nil, cleanup, fmt.Errorf("unable to write filter file: %w", err)
+			}
+		}
+	}
+	for _, p := range filePatterns {
+		if !p.unignore {
+			if _, err := fmt.Fprintf(writer, "- %s\n", p.pattern); err != nil {
+				filter.Close()
+				return nil, cleanup, fmt.Errorf("unable to write filter file: %w", err)
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		filter.Close()
+		return nil, cleanup, fmt.Errorf("unable to flush filter file: %w", err)
+	}
+	if err := filter.Close(); err != nil {
+		return nil, cleanup, fmt.Errorf("unable to close filter file: %w", err)
+	}
+
+	arguments = append(arguments, fmt.Sprintf(rsyncFilterMergeFlagFormat, filter.Name()))
+	return arguments, cleanup, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseExcludeFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-excludes-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	os.Setenv("SNAPPER_TEST_HOME", "/home/test")
+	defer os.Unsetenv("SNAPPER_TEST_HOME")
+
+	contents := "" +
+		"# a comment\n" +
+		"\n" +
+		"*.tmp\n" +
+		"   \n" +
+		"!important.tmp\n" +
+		"$SNAPPER_TEST_HOME/cache\n"
+	path := filepath.Join(directory, "excludes.txt")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("unable to write exclude file: %v", err)
+	}
+
+	patterns, err := parseExcludeFile(path)
+	if err != nil {
+		t.Fatalf("parseExcludeFile failed: %v", err)
+	}
+
+	expected := []excludePattern{
+		{pattern: "*.tmp", unignore: false},
+		{pattern: "important.tmp", unignore: true},
+		{pattern: "/home/test/cache", unignore: false},
+	}
+	if len(patterns) != len(expected) {
+		t.Fatalf("got %d patterns, expected %d: %+v", len(patterns), len(expected), patterns)
+	}
+	for i, p := range patterns {
+		if p != expected[i] {
+			t.Errorf("pattern %d: got %+v, expected %+v", i, p, expected[i])
+		}
+	}
+}
+
+func TestRsyncExcludeArgumentsSimpleOnly(t *testing.T) {
+	arguments, cleanup, err := rsyncExcludeArguments([]string{"foo", "bar"}, nil)
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("rsyncExcludeArguments failed: %v", err)
+	}
+	expected := []string{"--exclude=foo", "--exclude=bar"}
+	if len(arguments) != len(expected) {
+		t.Fatalf("got %v, expected %v", arguments, expected)
+	}
+	for i, a := range arguments {
+		if a != expected[i] {
+			t.Errorf("argument %d: got %q, expected %q", i, a, expected[i])
+		}
+	}
+}
+
+func TestRsyncExcludeArgumentsWithFilterFile(t *testing.T) {
+	patterns := []excludePattern{
+		{pattern: "*.tmp", unignore: false},
+		{pattern: "important.tmp", unignore: true},
+	}
+	arguments, cleanup, err := rsyncExcludeArguments(nil, patterns)
+	defer cleanup()
+	if err != nil {
+		t.Fatalf("rsyncExcludeArguments failed: %v", err)
+	}
+	if len(arguments) != 1 {
+		t.Fatalf("expected a single merged filter argument, got %v", arguments)
+	}
+
+	const prefix = "--filter=merge "
+	if len(arguments[0]) <= len(prefix) || arguments[0][:len(prefix)] != prefix {
+		t.Fatalf("expected filter merge argument, got %q", arguments[0])
+	}
+	filterPath := arguments[0][len(prefix):]
+
+	contents, err := ioutil.ReadFile(filterPath)
+	if err != nil {
+		t.Fatalf("unable to read generated filter file: %v", err)
+	}
+	// Filter rules are first-match-wins, so the "+" unignore rule must
+	// precede the "-" exclude rule it re-includes underneath, or it would
+	// never be reached.
+	expected := "+ important.tmp\n- *.tmp\n"
+	if string(contents) != expected {
+		t.Errorf("got filter contents %q, expected %q", contents, expected)
+	}
+
+	cleanup()
+	if _, err := os.Stat(filterPath); !os.IsNotExist(err) {
+		t.Errorf("expected filter file to be removed after cleanup, stat error: %v", err)
+	}
+}
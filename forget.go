@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+var forgetUsage = `usage: snapper forget [-h|--help] [-keep-last=<n>] [-keep-hourly=<n>] [-keep-daily=<n>]
+                       [-keep-weekly=<n>] [-keep-monthly=<n>] [-keep-yearly=<n>]
+                       [-keep-within=<duration>] [-keep-tag=<tag>] [-dry-run] [-prune]
+                       [-retry-lock=<duration>] <snapshots>
+`
+
+// forgetMain implements the "snapper forget" subcommand.
+func forgetMain(arguments []string) error {
+	flags := flag.NewFlagSet("forget", flag.ContinueOnError)
+	flags.Usage = func() {}
+	flags.SetOutput(ioutil.Discard)
+	keepLast := flags.Int("keep-last", 0, "keep the N most recent snapshots")
+	keepHourly := flags.Int("keep-hourly", 0, "keep the newest snapshot in each of the N most recent hourly buckets")
+	keepDaily := flags.Int("keep-daily", 0, "keep the newest snapshot in each of the N most recent daily buckets")
+	keepWeekly := flags.Int("keep-weekly", 0, "keep the newest snapshot in each of the N most recent weekly buckets")
+	keepMonthly := flags.Int("keep-monthly", 0, "keep the newest snapshot in each of the N most recent monthly buckets")
+	keepYearly := flags.Int("keep-yearly", 0, "keep the newest snapshot in each of the N most recent yearly buckets")
+	keepWithin := flags.Duration("keep-within", 0, "keep all snapshots newer than this duration")
+	var keepTags tags
+	flags.Var(&keepTags, "keep-tag", "keep all snapshots carrying this tag (repeatable)")
+	dryRun := flags.Bool("dry-run", false, "report what would be removed without removing it")
+	prune := flags.Bool("prune", false, "re-point the Latest symlink if its target was removed")
+	retryLock := flags.Duration("retry-lock", 0, "retry for this duration if the snapshots directory is locked by another process")
+	if err := flags.Parse(arguments); err == flag.ErrHelp {
+		fmt.Print(forgetUsage)
+		os.Exit(0)
+	} else if err != nil {
+		return fmt.Errorf("%w\n%s", err, forgetUsage)
+	}
+	positional := flags.Args()
+	if len(positional) != 1 {
+		return fmt.Errorf("invalid number of positional arguments\n%s", forgetUsage)
+	}
+	snapshotsDirectory := positional[0]
+
+	// Take an exclusive lock on the snapshots directory before mutating it,
+	// so that a concurrent "snapper backup" can't resolve a parent via
+	// "-parent=auto" or update the Latest symlink while we're mid-removal.
+	if !*dryRun {
+		lock, err := acquireLock(filepath.Join(snapshotsDirectory, lockFileName), *retryLock)
+		if err != nil {
+			return fmt.Errorf("unable to lock snapshots directory: %w", err)
+		}
+		defer lock.Release()
+	}
+
+	all, err := snapshots.List(snapshotsDirectory)
+	if err != nil {
+		return fmt.Errorf("unable to list snapshots: %w", err)
+	}
+
+	policy := retentionPolicy{
+		keepLast:    *keepLast,
+		keepHourly:  *keepHourly,
+		keepDaily:   *keepDaily,
+		keepWeekly:  *keepWeekly,
+		keepMonthly: *keepMonthly,
+		keepYearly:  *keepYearly,
+		keepWithin:  *keepWithin,
+		keepTags:    keepTags,
+	}
+	_, remove := applyRetentionPolicy(all, policy, time.Now().UTC())
+
+	lastestSnapshotLink := filepath.Join(snapshotsDirectory, latestSnapshotLinkName)
+	previousLatest, _ := os.Readlink(lastestSnapshotLink)
+	latestRemoved := false
+
+	for _, s := range remove {
+		fmt.Printf("removing snapshot %s\n", s.Name)
+		if *dryRun {
+			continue
+		}
+		if err := os.RemoveAll(s.Path); err != nil {
+			return fmt.Errorf("unable to remove snapshot %s: %w", s.Name, err)
+		}
+		if s.Name == previousLatest {
+			latestRemoved = true
+		}
+	}
+
+	if *prune && latestRemoved && !*dryRun {
+		kept, err := snapshots.List(snapshotsDirectory)
+		if err != nil {
+			return fmt.Errorf("unable to re-list snapshots: %w", err)
+		}
+		if err := os.Remove(lastestSnapshotLink); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove latest backup link: %w", err)
+		}
+		if len(kept) > 0 {
+			newest := kept[len(kept)-1]
+			if err := os.Symlink(newest.Name, lastestSnapshotLink); err != nil {
+				return fmt.Errorf("unable to update latest backup link: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
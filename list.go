@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+var snapshotsUsage = `usage: snapper snapshots [-h|--help] [-host=<host>] [-tag=<tag>] [-path=<path>] <snapshots>
+`
+
+// snapshotsMain implements the "snapper snapshots" subcommand.
+func snapshotsMain(arguments []string) error {
+	flags := flag.NewFlagSet("snapshots", flag.ContinueOnError)
+	flags.Usage = func() {}
+	flags.SetOutput(ioutil.Discard)
+	host := flags.String("host", "", "restrict listing to snapshots from this host")
+	tag := flags.String("tag", "", "restrict listing to snapshots carrying this tag")
+	path := flags.String("path", "", "restrict listing to snapshots with this source root")
+	if err := flags.Parse(arguments); err == flag.ErrHelp {
+		fmt.Print(snapshotsUsage)
+		os.Exit(0)
+	} else if err != nil {
+		return fmt.Errorf("%w\n%s", err, snapshotsUsage)
+	}
+	positional := flags.Args()
+	if len(positional) != 1 {
+		return fmt.Errorf("invalid number of positional arguments\n%s", snapshotsUsage)
+	}
+	snapshotsDirectory := positional[0]
+
+	all, err := snapshots.List(snapshotsDirectory)
+	if err != nil {
+		return fmt.Errorf("unable to list snapshots: %w", err)
+	}
+
+	filter := &snapshots.Filter{Host: *host, Tag: *tag, Path: *path}
+	filtered := filter.Apply(all)
+
+	printSnapshotsTable(filtered)
+	return nil
+}
+
+// printSnapshotsTable prints a simple tabular listing of snapshots to
+// stdout, in the style of restic's "snapshots" command.
+func printSnapshotsTable(list []snapshots.Snapshot) {
+	fmt.Printf("%-17s %-20s %-8s %s\n", "ID", "HOST", "TAGS", "ROOT")
+	for _, s := range list {
+		fmt.Printf("%-17s %-20s %-8s %s\n", s.Name, s.Metadata.Host, strings.Join(s.Metadata.Tags, ","), s.Metadata.Root)
+	}
+}
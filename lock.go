@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// lockFileName is the name of the exclusive lock file maintained inside
+	// a snapshots directory to prevent concurrent mutation.
+	lockFileName = "snapper.lock"
+
+	// lockRetryInitialBackoff is the initial delay between lock acquisition
+	// attempts when "-retry-lock" is specified.
+	lockRetryInitialBackoff = 1 * time.Second
+
+	// lockRetryMaxBackoff is the cap on the exponential backoff delay
+	// between lock acquisition attempts.
+	lockRetryMaxBackoff = 1 * time.Minute
+)
+
+// fileLock represents a held exclusive lock on a file.
+type fileLock struct {
+	file *os.File
+	path string
+}
+
+// acquireLock opens (creating if necessary) the lock file at path and
+// attempts to take an exclusive lock on it. If the lock is held elsewhere,
+// it retries with exponential backoff (starting at lockRetryInitialBackoff
+// and capping at lockRetryMaxBackoff) until retryFor has elapsed. A retryFor
+// of zero means fail immediately without retrying, matching the default
+// behavior of "-retry-lock".
+func acquireLock(path string, retryFor time.Duration) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(retryFor)
+	backoff := lockRetryInitialBackoff
+	for {
+		lockErr := tryLock(file)
+		if lockErr == nil {
+			return &fileLock{file: file, path: path}, nil
+		}
+		if retryFor <= 0 {
+			file.Close()
+			return nil, fmt.Errorf("unable to acquire lock (held by another process): %w", lockErr)
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			file.Close()
+			return nil, fmt.Errorf("unable to acquire lock (held by another process): %w", lockErr)
+		}
+		sleep := backoff
+		if remaining < sleep {
+			sleep = remaining
+		}
+		time.Sleep(sleep)
+		backoff *= 2
+		if backoff > lockRetryMaxBackoff {
+			backoff = lockRetryMaxBackoff
+		}
+	}
+}
+
+// Release unlocks the lock file. It deliberately leaves the lock file in
+// place on disk rather than removing it: unlinking it here would race with a
+// waiter that's already holding the file open (e.g. mid "-retry-lock"
+// backoff) acquiring the flock on the about-to-be-unlinked inode just as a
+// third process's acquireLock recreates the path and locks a brand-new
+// inode, letting two processes hold "the" lock at once. Leaving the lock
+// file in place is harmless, since acquireLock only ever needs it to exist
+// to flock.
+func (l *fileLock) Release() error {
+	defer l.file.Close()
+	if err := unlock(l.file); err != nil {
+		return fmt.Errorf("unable to release lock: %w", err)
+	}
+	return nil
+}
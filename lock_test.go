@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireLockExclusive(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-lock-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, lockFileName)
+	lock, err := acquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+
+	if _, err := acquireLock(path, 0); err == nil {
+		t.Error("expected second acquireLock to fail while first lock is held")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+
+	lock2, err := acquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("acquireLock after release failed: %v", err)
+	}
+	lock2.Release()
+}
+
+func TestAcquireLockRetryTimesOut(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-lock-retry-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, lockFileName)
+	lock, err := acquireLock(path, 0)
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+	defer lock.Release()
+
+	start := time.Now()
+	if _, err := acquireLock(path, 50*time.Millisecond); err == nil {
+		t.Error("expected retrying acquireLock to time out while lock is held")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected acquireLock to wait at least the retry duration, waited %v", elapsed)
+	}
+}
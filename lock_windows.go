@@ -0,0 +1,58 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// lockfileExclusiveLockFlag and lockfileFailImmediatelyFlag are the dwFlags
+// values for the Windows LockFileEx API (LOCKFILE_EXCLUSIVE_LOCK and
+// LOCKFILE_FAIL_IMMEDIATELY, respectively). See
+// https://docs.microsoft.com/en-us/windows/win32/api/fileapi/nf-fileapi-lockfileex.
+const (
+	lockfileExclusiveLockFlag   = 0x00000002
+	lockfileFailImmediatelyFlag = 0x00000001
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+// tryLock attempts to take a non-blocking exclusive LockFileEx lock on file.
+func tryLock(file *os.File) error {
+	var overlapped syscall.Overlapped
+	ret, _, err := procLockFileEx.Call(
+		file.Fd(),
+		uintptr(lockfileExclusiveLockFlag|lockfileFailImmediatelyFlag),
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// unlock releases a lock previously taken with tryLock.
+func unlock(file *os.File) error {
+	var overlapped syscall.Overlapped
+	ret, _, err := procUnlockFileEx.Call(
+		file.Fd(),
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
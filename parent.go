@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+const (
+	// parentAuto is the default "-parent" value: pick the most recent
+	// snapshot matching the current host and tags, reproducing the
+	// historical "link against Latest" behavior but scoped to this
+	// machine/tag set.
+	parentAuto = "auto"
+
+	// parentNone is the "-parent" value that forces a full copy with no
+	// hardlink base.
+	parentNone = "none"
+
+	// maxLinkDestBases is the maximum number of "--link-dest" arguments
+	// rsync accepts.
+	maxLinkDestBases = 20
+)
+
+// parentOptions collects the "-parent"/"-parent-host"/"-parent-tag"/
+// "-link-dest-parent" flags used to select hardlink bases for a backup.
+type parentOptions struct {
+	// parent is the "-parent" value: a snapshot name, "auto", or "none".
+	parent string
+	// host, if non-empty, restricts "auto" resolution to snapshots from
+	// this host instead of the current host.
+	host string
+	// tag, if non-empty, restricts "auto" resolution to snapshots
+	// carrying this tag instead of matching the current backup's tags.
+	tag string
+	// extra lists additional snapshot names to hardlink against, via
+	// repeated "-link-dest-parent" flags.
+	extra []string
+}
+
+// resolveParents determines the set of existing snapshot directories to use
+// as rsync "--link-dest" bases, validating that each resolved parent is a
+// directory. snapshotsDirectory is scanned for existing snapshots; host and
+// tags describe the snapshot currently being created and are used to scope
+// "-parent=auto" resolution when "-parent-host"/"-parent-tag" aren't given.
+func resolveParents(snapshotsDirectory string, opts parentOptions, host string, tags []string) ([]string, error) {
+	var bases []string
+
+	parent := opts.parent
+	if parent == "" {
+		parent = parentAuto
+	}
+
+	if parent != parentNone {
+		all, err := snapshots.List(snapshotsDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list existing snapshots: %w", err)
+		}
+
+		var primary *snapshots.Snapshot
+		if parent == parentAuto {
+			requiredHost := opts.host
+			if requiredHost == "" {
+				requiredHost = host
+			}
+
+			// opts.tag ("-parent-tag") names a single explicit tag to restrict
+			// to, overriding the current backup's own tags entirely. Otherwise
+			// a candidate must carry every one of the current backup's tags,
+			// not just the first, or a snapshot sharing only one of several
+			// tags could be selected as parent despite not actually matching
+			// this backup's full tag set.
+			requiredTags := tags
+			if opts.tag != "" {
+				requiredTags = []string{opts.tag}
+			}
+
+			filter := &snapshots.Filter{Host: requiredHost}
+			candidates := filter.Apply(all)
+			for i := len(candidates) - 1; i >= 0; i-- {
+				matches := true
+				for _, tag := range requiredTags {
+					if !candidates[i].Metadata.HasTag(tag) {
+						matches = false
+						break
+					}
+				}
+				if matches {
+					primary = &candidates[i]
+					break
+				}
+			}
+		} else {
+			for i := range all {
+				if all[i].Name == parent {
+					primary = &all[i]
+					break
+				}
+			}
+			if primary == nil {
+				return nil, fmt.Errorf("parent snapshot %q not found", parent)
+			}
+		}
+
+		if primary != nil {
+			bases = append(bases, primary.Path)
+		}
+
+		for _, name := range opts.extra {
+			path := filepath.Join(snapshotsDirectory, name)
+			var found bool
+			for _, b := range bases {
+				if b == path {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+			bases = append(bases, path)
+		}
+	}
+
+	for _, base := range bases {
+		info, err := os.Stat(base)
+		if err != nil {
+			return nil, fmt.Errorf("unable to inspect parent snapshot %q: %w", base, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("parent snapshot %q is not a directory", base)
+		}
+	}
+
+	if len(bases) > maxLinkDestBases {
+		return nil, fmt.Errorf("too many parent snapshots resolved (%d), rsync supports at most %d --link-dest bases", len(bases), maxLinkDestBases)
+	}
+
+	return bases, nil
+}
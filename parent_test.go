@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+func writeParentSnapshot(t *testing.T, directory, name string, metadata *snapshots.Metadata) {
+	t.Helper()
+	path := filepath.Join(directory, name)
+	if err := os.Mkdir(path, 0700); err != nil {
+		t.Fatalf("unable to create snapshot directory: %v", err)
+	}
+	if err := metadata.Save(path); err != nil {
+		t.Fatalf("unable to save metadata: %v", err)
+	}
+}
+
+func TestResolveParentsAuto(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-parent-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	writeParentSnapshot(t, directory, "20260101T000000Z", &snapshots.Metadata{Host: "host-a"})
+	writeParentSnapshot(t, directory, "20260102T000000Z", &snapshots.Metadata{Host: "host-b"})
+
+	bases, err := resolveParents(directory, parentOptions{parent: parentAuto}, "host-a", nil)
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(bases) != 1 || filepath.Base(bases[0]) != "20260101T000000Z" {
+		t.Errorf("expected auto resolution to pick host-a's snapshot, got %v", bases)
+	}
+}
+
+func TestResolveParentsAutoRequiresAllTags(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-parent-tags-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	// Shares only the first of the current backup's tags.
+	writeParentSnapshot(t, directory, "20260101T000000Z", &snapshots.Metadata{Host: "host-a", Tags: []string{"nightly"}})
+	// Shares all of the current backup's tags.
+	writeParentSnapshot(t, directory, "20260102T000000Z", &snapshots.Metadata{Host: "host-a", Tags: []string{"nightly", "offsite"}})
+
+	bases, err := resolveParents(directory, parentOptions{parent: parentAuto}, "host-a", []string{"nightly", "offsite"})
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(bases) != 1 || filepath.Base(bases[0]) != "20260102T000000Z" {
+		t.Errorf("expected auto resolution to require all current tags, got %v", bases)
+	}
+}
+
+func TestResolveParentsNone(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-parent-none-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	writeParentSnapshot(t, directory, "20260101T000000Z", &snapshots.Metadata{Host: "host-a"})
+
+	bases, err := resolveParents(directory, parentOptions{parent: parentNone}, "host-a", nil)
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(bases) != 0 {
+		t.Errorf("expected no parents with -parent=none, got %v", bases)
+	}
+}
+
+func TestResolveParentsNamedAndExtra(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-parent-named-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	writeParentSnapshot(t, directory, "20260101T000000Z", &snapshots.Metadata{Host: "host-a"})
+	writeParentSnapshot(t, directory, "20260102T000000Z", &snapshots.Metadata{Host: "host-a"})
+
+	bases, err := resolveParents(directory, parentOptions{
+		parent: "20260101T000000Z",
+		extra:  []string{"20260102T000000Z"},
+	}, "host-a", nil)
+	if err != nil {
+		t.Fatalf("resolveParents failed: %v", err)
+	}
+	if len(bases) != 2 {
+		t.Fatalf("expected 2 resolved parents, got %v", bases)
+	}
+
+	if _, err := resolveParents(directory, parentOptions{parent: "does-not-exist"}, "host-a", nil); err == nil {
+		t.Error("expected resolveParents to fail for an unknown named parent")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// rsyncJSONInfoFlag tells rsync to emit machine-parseable progress
+	// information instead of the default human-readable "-P" output.
+	rsyncJSONInfoFlag = "--info=progress2"
+
+	// rsyncJSONOutFormatFlag tells rsync to emit one line per transferred
+	// file in a "|"-delimited format: itemized change summary, file name,
+	// file length, and bytes actually sent for that file. See "man rsync"
+	// (OUTPUT section) for the %i/%n/%l/%b format specifiers.
+	rsyncJSONOutFormatFlag = `--out-format=%i|%n|%l|%b`
+
+	// jsonStatusInterval is the throttling interval between "status"
+	// messages emitted in "-json" mode.
+	jsonStatusInterval = 1 * time.Second
+)
+
+// rsyncOutFormatLinePattern matches lines produced by rsyncJSONOutFormatFlag.
+var rsyncOutFormatLinePattern = regexp.MustCompile(`^([<>ch.*][a-zA-Z.+*]{10})\|(.*)\|(\d+)\|(\d+)$`)
+
+// rsyncProgress2PercentPattern extracts the overall percentage from an
+// "--info=progress2" summary line, e.g.:
+//	      1,234,567  43%  123.45kB/s    0:00:12 (xfr#5, to-chk=10/20)
+var rsyncProgress2PercentPattern = regexp.MustCompile(`(\d+)%`)
+
+// jsonStatusMessage is a periodic progress update emitted in "-json" mode.
+type jsonStatusMessage struct {
+	MessageType      string  `json:"message_type"`
+	FilesProcessed   int     `json:"files_processed"`
+	BytesTransferred int64   `json:"bytes_transferred"`
+	PercentDone      float64 `json:"percent_done"`
+}
+
+// jsonSummaryMessage is the final record emitted in "-json" mode once rsync
+// has exited.
+type jsonSummaryMessage struct {
+	MessageType     string    `json:"message_type"`
+	SnapshotID      string    `json:"snapshot_id"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	TotalBytes      int64     `json:"total_bytes"`
+	RsyncExitCode   int       `json:"rsync_exit_code"`
+	ParentUsed      bool      `json:"parent_used"`
+}
+
+// rsyncProgressState tracks the running totals parsed out of rsync's
+// machine-readable output stream.
+type rsyncProgressState struct {
+	mutex            sync.Mutex
+	filesProcessed   int
+	bytesTransferred int64
+	percentDone      float64
+}
+
+func (s *rsyncProgressState) recordTransfer(bytes int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.filesProcessed++
+	s.bytesTransferred += bytes
+}
+
+func (s *rsyncProgressState) recordPercent(percent float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.percentDone = percent
+}
+
+func (s *rsyncProgressState) snapshot() jsonStatusMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return jsonStatusMessage{
+		MessageType:      "status",
+		FilesProcessed:   s.filesProcessed,
+		BytesTransferred: s.bytesTransferred,
+		PercentDone:      s.percentDone,
+	}
+}
+
+// parseRsyncJSONOutput scans rsync's combined "--info=progress2" and
+// out-format stream, updating state as lines are recognized. Unrecognized
+// lines are ignored, since rsync interleaves the two formats along with
+// occasional banners.
+func parseRsyncJSONOutput(output io.Reader, state *rsyncProgressState) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := rsyncOutFormatLinePattern.FindStringSubmatch(line); match != nil {
+			if bytes, err := strconv.ParseInt(match[4], 10, 64); err == nil {
+				state.recordTransfer(bytes)
+			}
+			continue
+		}
+		if match := rsyncProgress2PercentPattern.FindStringSubmatch(line); match != nil {
+			if percent, err := strconv.ParseFloat(match[1], 64); err == nil {
+				state.recordPercent(percent)
+			}
+		}
+	}
+}
+
+// runRsyncJSON runs rsync with JSON progress reporting enabled, writing
+// throttled "status" messages and a final "summary" message as
+// newline-delimited JSON to output. It returns the rsync exit code and the
+// total bytes transferred, as tracked by the parsed output stream.
+func runRsyncJSON(ctx context.Context, rsyncArguments []string, output io.Writer, snapshotID string, parentUsed bool) (int, int64, error) {
+	rsync := exec.CommandContext(ctx, rsyncCommand, rsyncArguments...)
+	stdout, err := rsync.StdoutPipe()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to create rsync stdout pipe: %w", err)
+	}
+	rsync.Stderr = os.Stderr
+
+	state := &rsyncProgressState{}
+
+	startTime := time.Now()
+	if err := rsync.Start(); err != nil {
+		return 0, 0, fmt.Errorf("unable to start rsync: %w", err)
+	}
+
+	var parseWait sync.WaitGroup
+	parseWait.Add(1)
+	go func() {
+		defer parseWait.Done()
+		parseRsyncJSONOutput(stdout, state)
+	}()
+
+	// Run the periodic status ticker in its own goroutine, but stop it (and
+	// wait for it to actually exit) before writing the final summary line
+	// below, rather than merely deferring the stop to function return — a
+	// deferred stop would only fire after the summary had already been
+	// written, leaving a window where the ticker could still emit a status
+	// line racing on (or trailing after) the summary on the same writer.
+	done := make(chan struct{})
+	var tickerWait sync.WaitGroup
+	tickerWait.Add(1)
+	go func() {
+		defer tickerWait.Done()
+		ticker := time.NewTicker(jsonStatusInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				message := state.snapshot()
+				data, err := json.Marshal(message)
+				if err == nil {
+					fmt.Fprintln(output, string(data))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	stopTicker := func() {
+		close(done)
+		tickerWait.Wait()
+	}
+
+	exitCode := 0
+	if runErr := rsync.Wait(); runErr != nil {
+		if exitErr, ok := runErr.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else {
+			stopTicker()
+			return 0, 0, fmt.Errorf("rsync execution error: %w", runErr)
+		}
+	}
+	parseWait.Wait()
+	stopTicker()
+	endTime := time.Now()
+
+	final := state.snapshot()
+	summary := jsonSummaryMessage{
+		MessageType:     "summary",
+		SnapshotID:      snapshotID,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		DurationSeconds: endTime.Sub(startTime).Seconds(),
+		TotalBytes:      final.BytesTransferred,
+		RsyncExitCode:   exitCode,
+		ParentUsed:      parentUsed,
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return exitCode, final.BytesTransferred, fmt.Errorf("unable to marshal summary: %w", err)
+	}
+	fmt.Fprintln(output, string(data))
+
+	return exitCode, final.BytesTransferred, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRsyncJSONOutput(t *testing.T) {
+	output := strings.Join([]string{
+		// This is the real shape rsync emits for "--out-format=%i|%n|%l|%b":
+		// the itemize field is immediately followed by "|", with no space.
+		">f+++++++++|file1.txt|100|100",
+		"         100,000  43%  123.45kB/s    0:00:12 (xfr#1, to-chk=2/3)",
+		">f+++++++++|file2.txt|50|50",
+		"         150,000 100%  234.56kB/s    0:00:20 (xfr#2, to-chk=0/3)",
+	}, "\n")
+
+	state := &rsyncProgressState{}
+	parseRsyncJSONOutput(strings.NewReader(output), state)
+
+	snapshot := state.snapshot()
+	if snapshot.FilesProcessed != 2 {
+		t.Errorf("got %d files processed, expected 2", snapshot.FilesProcessed)
+	}
+	if snapshot.BytesTransferred != 150 {
+		t.Errorf("got %d bytes transferred, expected 150", snapshot.BytesTransferred)
+	}
+	if snapshot.PercentDone != 100 {
+		t.Errorf("got %.2f%% done, expected 100%%", snapshot.PercentDone)
+	}
+}
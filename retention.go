@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+// retentionPolicy describes a restic-style "forget" retention policy.
+type retentionPolicy struct {
+	// keepLast keeps the N most recent snapshots overall.
+	keepLast int
+	// keepHourly keeps the newest snapshot in each of the N most recent
+	// hourly buckets.
+	keepHourly int
+	// keepDaily keeps the newest snapshot in each of the N most recent
+	// daily buckets.
+	keepDaily int
+	// keepWeekly keeps the newest snapshot in each of the N most recent
+	// weekly buckets.
+	keepWeekly int
+	// keepMonthly keeps the newest snapshot in each of the N most recent
+	// monthly buckets.
+	keepMonthly int
+	// keepYearly keeps the newest snapshot in each of the N most recent
+	// yearly buckets.
+	keepYearly int
+	// keepWithin keeps all snapshots newer than "now - keepWithin". A zero
+	// value disables this rule.
+	keepWithin time.Duration
+	// keepTags keeps all snapshots carrying any of these tags.
+	keepTags []string
+}
+
+// bucketKeyFunc computes the bucket key for a snapshot's timestamp under a
+// particular granularity (e.g. the ISO week for "weekly").
+type bucketKeyFunc func(time.Time) string
+
+func hourlyBucketKey(t time.Time) string {
+	return t.Format("2006-01-02T15")
+}
+
+func dailyBucketKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func weeklyBucketKey(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+func monthlyBucketKey(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+func yearlyBucketKey(t time.Time) string {
+	return t.Format("2006")
+}
+
+// keepNewestPerBucket groups snaps (assumed sorted oldest-first, as returned
+// by snapshots.List) by the bucket key function and marks the newest
+// snapshot in each of the "count" most recent non-empty buckets as kept.
+func keepNewestPerBucket(snaps []snapshots.Snapshot, key bucketKeyFunc, count int, keep map[string]bool) {
+	if count <= 0 {
+		return
+	}
+
+	// newestInBucket records, for each bucket, the name of the newest
+	// snapshot seen so far in that bucket, along with the order in which
+	// buckets were first encountered (walking newest-to-oldest so that the
+	// first "count" distinct buckets are the most recent ones).
+	var order []string
+	newestInBucket := make(map[string]string)
+	for i := len(snaps) - 1; i >= 0; i-- {
+		s := snaps[i]
+		k := key(s.Metadata.Timestamp)
+		if _, exists := newestInBucket[k]; !exists {
+			order = append(order, k)
+			newestInBucket[k] = s.Name
+		}
+	}
+
+	if count > len(order) {
+		count = len(order)
+	}
+	for _, k := range order[:count] {
+		keep[newestInBucket[k]] = true
+	}
+}
+
+// isEmpty returns whether the policy specifies no retention rules at all,
+// i.e. every "-keep-*" option is at its zero value.
+func (p *retentionPolicy) isEmpty() bool {
+	return p.keepLast == 0 && p.keepHourly == 0 && p.keepDaily == 0 &&
+		p.keepWeekly == 0 && p.keepMonthly == 0 && p.keepYearly == 0 &&
+		p.keepWithin == 0 && len(p.keepTags) == 0
+}
+
+// applyRetentionPolicy determines which snapshots should be kept under the
+// given policy, evaluated relative to now. snaps is expected to be sorted
+// oldest-first, as returned by snapshots.List. It returns the set of
+// snapshots to keep and the set to remove. An entirely empty policy (no
+// "-keep-*" options specified) keeps everything rather than removing every
+// snapshot, matching restic's treatment of an empty "forget" invocation.
+func applyRetentionPolicy(snaps []snapshots.Snapshot, policy retentionPolicy, now time.Time) (keep, remove []snapshots.Snapshot) {
+	if policy.isEmpty() {
+		return append([]snapshots.Snapshot{}, snaps...), nil
+	}
+
+	keepNames := make(map[string]bool)
+
+	if policy.keepLast > 0 {
+		start := len(snaps) - policy.keepLast
+		if start < 0 {
+			start = 0
+		}
+		for _, s := range snaps[start:] {
+			keepNames[s.Name] = true
+		}
+	}
+
+	keepNewestPerBucket(snaps, hourlyBucketKey, policy.keepHourly, keepNames)
+	keepNewestPerBucket(snaps, dailyBucketKey, policy.keepDaily, keepNames)
+	keepNewestPerBucket(snaps, weeklyBucketKey, policy.keepWeekly, keepNames)
+	keepNewestPerBucket(snaps, monthlyBucketKey, policy.keepMonthly, keepNames)
+	keepNewestPerBucket(snaps, yearlyBucketKey, policy.keepYearly, keepNames)
+
+	if policy.keepWithin > 0 {
+		threshold := now.Add(-policy.keepWithin)
+		for _, s := range snaps {
+			if s.Metadata.Timestamp.After(threshold) {
+				keepNames[s.Name] = true
+			}
+		}
+	}
+
+	for _, tag := range policy.keepTags {
+		for _, s := range snaps {
+			if s.Metadata.HasTag(tag) {
+				keepNames[s.Name] = true
+			}
+		}
+	}
+
+	for _, s := range snaps {
+		if keepNames[s.Name] {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+
+	return keep, remove
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/havoc-io/snapper/snapshots"
+)
+
+func snap(name string, ts time.Time, tags ...string) snapshots.Snapshot {
+	return snapshots.Snapshot{
+		Name: name,
+		Path: "/snapshots/" + name,
+		Metadata: &snapshots.Metadata{
+			Timestamp: ts,
+			Tags:      tags,
+		},
+	}
+}
+
+func TestApplyRetentionPolicy(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	snaps := []snapshots.Snapshot{
+		snap("s1", now.AddDate(0, 0, -10)),
+		snap("s2", now.AddDate(0, 0, -9)),
+		snap("s3", now.AddDate(0, 0, -2)),
+		snap("s4", now.AddDate(0, 0, -1)),
+		snap("s5", now),
+	}
+
+	tests := []struct {
+		name   string
+		policy retentionPolicy
+		keep   []string
+	}{
+		{
+			name:   "keep-last",
+			policy: retentionPolicy{keepLast: 2},
+			keep:   []string{"s4", "s5"},
+		},
+		{
+			name:   "keep-daily",
+			policy: retentionPolicy{keepDaily: 3},
+			keep:   []string{"s3", "s4", "s5"},
+		},
+		{
+			name:   "keep-within",
+			policy: retentionPolicy{keepWithin: 36 * time.Hour},
+			keep:   []string{"s4", "s5"},
+		},
+		{
+			name:   "keep-tag",
+			policy: retentionPolicy{keepTags: []string{"pinned"}},
+			keep:   []string{"s1"},
+		},
+		{
+			name:   "empty-policy-keeps-everything",
+			policy: retentionPolicy{},
+			keep:   []string{"s1", "s2", "s3", "s4", "s5"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapsCopy := append([]snapshots.Snapshot{}, snaps...)
+			if test.name == "keep-tag" {
+				snapsCopy[0] = snap("s1", now.AddDate(0, 0, -10), "pinned")
+			}
+			keep, remove := applyRetentionPolicy(snapsCopy, test.policy, now)
+			if len(keep)+len(remove) != len(snapsCopy) {
+				t.Fatalf("keep+remove count mismatch: %d+%d != %d", len(keep), len(remove), len(snapsCopy))
+			}
+			keptNames := make(map[string]bool)
+			for _, s := range keep {
+				keptNames[s.Name] = true
+			}
+			if len(keptNames) != len(test.keep) {
+				t.Fatalf("got kept %v, expected %v", keptNames, test.keep)
+			}
+			for _, name := range test.keep {
+				if !keptNames[name] {
+					t.Errorf("expected %s to be kept, got %v", name, keptNames)
+				}
+			}
+		})
+	}
+}
+
+func TestKeepNewestPerBucketOrdering(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	snaps := []snapshots.Snapshot{
+		snap("jan1", base),
+		snap("jan1-later", base.Add(time.Hour)),
+		snap("jan2", base.AddDate(0, 0, 1)),
+	}
+
+	keep := make(map[string]bool)
+	keepNewestPerBucket(snaps, dailyBucketKey, 1, keep)
+	if len(keep) != 1 || !keep["jan2"] {
+		t.Errorf("expected only jan2 kept for 1 most recent daily bucket, got %v", keep)
+	}
+
+	keep = make(map[string]bool)
+	keepNewestPerBucket(snaps, dailyBucketKey, 2, keep)
+	if len(keep) != 2 || !keep["jan1-later"] || !keep["jan2"] {
+		t.Errorf("expected jan1-later and jan2 kept for 2 most recent daily buckets, got %v", keep)
+	}
+}
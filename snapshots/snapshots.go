@@ -0,0 +1,172 @@
+// Package snapshots implements reading and writing of snapshot metadata and
+// enumeration/filtering of existing snapshots within a snapshots directory.
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MetadataFileName is the name of the metadata file written alongside
+	// each snapshot's contents.
+	MetadataFileName = "snapshot.json"
+
+	// TimestampFormat is the layout (in Go's reference time format) used
+	// for snapshot directory names. It's a UTC ISO-8601 basic format
+	// timestamp, chosen so that snapshot names sort lexicographically in
+	// chronological order.
+	TimestampFormat = "20060102T150405Z"
+
+	// metadataPermissions are the permissions used when writing the
+	// metadata file.
+	metadataPermissions = 0600
+)
+
+// Metadata describes a single snapshot. It's marshaled to JSON and stored as
+// MetadataFileName inside the snapshot's directory.
+type Metadata struct {
+	// Timestamp is the time at which the backup was started.
+	Timestamp time.Time `json:"timestamp"`
+	// Host is the hostname of the machine that created the snapshot.
+	Host string `json:"host"`
+	// Root is the source root path that was backed up.
+	Root string `json:"root"`
+	// Excludes is the set of resolved exclude patterns that were passed to
+	// rsync for this snapshot.
+	Excludes []string `json:"excludes,omitempty"`
+	// Tags is the set of user-supplied tags associated with this snapshot.
+	Tags []string `json:"tags,omitempty"`
+	// RsyncExitCode is the exit code returned by the rsync invocation.
+	RsyncExitCode int `json:"rsyncExitCode"`
+}
+
+// HasTag returns whether or not the metadata includes the given tag.
+func (m *Metadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes metadata to MetadataFileName inside directory.
+func (m *Metadata) Save(directory string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal snapshot metadata: %w", err)
+	}
+	path := filepath.Join(directory, MetadataFileName)
+	if err := ioutil.WriteFile(path, data, metadataPermissions); err != nil {
+		return fmt.Errorf("unable to write snapshot metadata: %w", err)
+	}
+	return nil
+}
+
+// Load reads and unmarshals metadata from MetadataFileName inside directory.
+func Load(directory string) (*Metadata, error) {
+	path := filepath.Join(directory, MetadataFileName)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot metadata: %w", err)
+	}
+	metadata := &Metadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal snapshot metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// Snapshot pairs a snapshot's directory name (its timestamp) with its
+// metadata.
+type Snapshot struct {
+	// Name is the snapshot's directory name, which is also its
+	// TimestampFormat-encoded timestamp.
+	Name string
+	// Path is the snapshot's full directory path.
+	Path string
+	// Metadata is the snapshot's associated metadata.
+	Metadata *Metadata
+}
+
+// List enumerates the snapshots inside snapshotsDirectory, skipping entries
+// that aren't snapshot directories (e.g. the Latest symlink or a lock file)
+// or that have no metadata file; a metadata file that exists but can't be
+// read or parsed is reported as an error. Results are sorted by name (and
+// thus chronologically, since snapshot names are TimestampFormat timestamps).
+func List(snapshotsDirectory string) ([]Snapshot, error) {
+	entries, err := ioutil.ReadDir(snapshotsDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshots directory: %w", err)
+	}
+
+	var result []Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(TimestampFormat, entry.Name()); err != nil {
+			continue
+		}
+		path := filepath.Join(snapshotsDirectory, entry.Name())
+		metadata, err := Load(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to load metadata for %s: %w", entry.Name(), err)
+		}
+		result = append(result, Snapshot{Name: entry.Name(), Path: path, Metadata: metadata})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// Filter is a set of criteria used to restrict a snapshot listing.
+type Filter struct {
+	// Host, if non-empty, restricts results to snapshots from that host.
+	Host string
+	// Tag, if non-empty, restricts results to snapshots carrying that tag.
+	Tag string
+	// Path, if non-empty, restricts results to snapshots whose root
+	// matches that path.
+	Path string
+}
+
+// Matches returns whether or not the snapshot satisfies the filter.
+func (f *Filter) Matches(s Snapshot) bool {
+	if f.Host != "" && s.Metadata.Host != f.Host {
+		return false
+	}
+	if f.Tag != "" && !s.Metadata.HasTag(f.Tag) {
+		return false
+	}
+	if f.Path != "" && strings.TrimSuffix(s.Metadata.Root, "/") != strings.TrimSuffix(f.Path, "/") {
+		return false
+	}
+	return true
+}
+
+// Apply returns a new slice holding only those snapshots that match f; the
+// input slice is left unchanged.
+func (f *Filter) Apply(snapshots []Snapshot) []Snapshot {
+	var result []Snapshot
+	for _, s := range snapshots {
+		if f.Matches(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package snapshots
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeSnapshot(t *testing.T, snapshotsDirectory, name string, metadata *Metadata) {
+	t.Helper()
+	directory := filepath.Join(snapshotsDirectory, name)
+	if err := os.Mkdir(directory, 0700); err != nil {
+		t.Fatalf("unable to create snapshot directory: %v", err)
+	}
+	if err := metadata.Save(directory); err != nil {
+		t.Fatalf("unable to save metadata: %v", err)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-snapshots-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	original := &Metadata{
+		Timestamp:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Host:          "workstation",
+		Root:          "/home/user/",
+		Excludes:      []string{"--exclude=*.tmp"},
+		Tags:          []string{"nightly"},
+		RsyncExitCode: 0,
+	}
+	if err := original.Save(directory); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(directory)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !loaded.Timestamp.Equal(original.Timestamp) || loaded.Host != original.Host || loaded.Root != original.Root {
+		t.Errorf("loaded metadata %+v does not match original %+v", loaded, original)
+	}
+}
+
+func TestListAndFilter(t *testing.T) {
+	directory, err := ioutil.TempDir("", "snapper-snapshots-list-test")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	// Root is stored with a trailing slash, since "snapper backup" always
+	// appends one before invoking rsync.
+	writeSnapshot(t, directory, "20260101T000000Z", &Metadata{Host: "a", Tags: []string{"nightly"}, Root: "/a/"})
+	writeSnapshot(t, directory, "20260102T000000Z", &Metadata{Host: "b", Tags: []string{"weekly"}, Root: "/b/"})
+
+	// Non-snapshot entries should be ignored.
+	if err := os.Symlink("20260102T000000Z", filepath.Join(directory, "Latest")); err != nil {
+		t.Fatalf("unable to create Latest symlink: %v", err)
+	}
+
+	all, err := List(directory)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d snapshots, expected 2", len(all))
+	}
+	if all[0].Name != "20260101T000000Z" || all[1].Name != "20260102T000000Z" {
+		t.Errorf("snapshots not sorted chronologically: %+v", all)
+	}
+
+	filter := &Filter{Host: "b"}
+	filtered := filter.Apply(all)
+	if len(filtered) != 1 || filtered[0].Name != "20260102T000000Z" {
+		t.Errorf("host filter returned unexpected results: %+v", filtered)
+	}
+
+	filter = &Filter{Tag: "nightly"}
+	filtered = filter.Apply(all)
+	if len(filtered) != 1 || filtered[0].Name != "20260101T000000Z" {
+		t.Errorf("tag filter returned unexpected results: %+v", filtered)
+	}
+
+	// "-path" is specified the way a user invokes "snapper backup" (without
+	// a trailing slash) and must still match against the stored root (with
+	// a trailing slash).
+	filter = &Filter{Path: "/a"}
+	filtered = filter.Apply(all)
+	if len(filtered) != 1 || filtered[0].Name != "20260101T000000Z" {
+		t.Errorf("path filter returned unexpected results: %+v", filtered)
+	}
+}